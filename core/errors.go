@@ -0,0 +1,13 @@
+package core
+
+import "github.com/akutz/goof"
+
+// ErrListNotSupported signals a driver can't enumerate all volumes.
+var ErrListNotSupported = goof.New("list not supported by driver")
+
+var (
+	ErrNotFound         = goof.New("volume not found")
+	ErrAlreadyExists    = goof.New("volume already exists")
+	ErrPermissionDenied = goof.New("permission denied")
+	ErrUnsupported      = goof.New("operation not supported by driver")
+)
@@ -0,0 +1,12 @@
+package core
+
+// Scope is the VolumeDriver.Capabilities scope reported to Docker.
+type Scope string
+
+const (
+	// ScopeGlobal volumes may be attached from any host in the cluster.
+	ScopeGlobal Scope = "global"
+
+	// ScopeLocal volumes may only be attached on the host that created them.
+	ScopeLocal Scope = "local"
+)
@@ -0,0 +1,15 @@
+package core
+
+// VolumeDriver is the interface a storage backend implements to provide
+// volume lifecycle operations to callers such as the Docker volume driver
+// plugin.
+type VolumeDriver interface {
+	Create(name string, opts VolumeOpts) error
+	Remove(name string) error
+	Path(name, overrideOpts string) (string, error)
+	Mount(name, overrideOpts string, overwriteFs bool, newFsType string, amNotMount bool) (string, error)
+	Unmount(name, overrideOpts string) error
+	Get(name string) (VolumeMap, error)
+	List() ([]VolumeMap, error)
+	Scope() Scope
+}
@@ -1,8 +1,12 @@
 package volumedriver
 
 import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
 	"encoding/json"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"net"
 	"net/http"
@@ -10,6 +14,7 @@ import (
 	"path/filepath"
 	"regexp"
 	"strings"
+	"sync"
 	"time"
 
 	log "github.com/Sirupsen/logrus"
@@ -22,6 +27,8 @@ import (
 
 const (
 	modName = "docker"
+
+	pluginContentType = "application/vnd.docker.plugins.v1.2+json"
 )
 
 type mod struct {
@@ -29,6 +36,22 @@ type mod struct {
 	name string
 	addr string
 	desc string
+
+	// seenVolsRWL guards seenVols, the in-process registry backing
+	// listFromRegistry.
+	seenVolsRWL sync.Mutex
+	seenVols    map[string]struct{}
+
+	// mountIDsRWL guards mountIDs, the per-volume mount ref-count.
+	mountIDsRWL sync.Mutex
+	mountIDs    map[string]map[string]struct{}
+
+	// volLocksRWL guards volLocks, a per-volume-name mutex serializing
+	// mountHandler/unmountHandler.
+	volLocksRWL sync.Mutex
+	volLocks    map[string]*sync.Mutex
+
+	metrics *metrics
 }
 
 var (
@@ -69,10 +92,11 @@ func newModule(c *module.Config) (module.Module, error) {
 	r.Context = c.Name
 
 	return &mod{
-		r:    r,
-		name: c.Name,
-		desc: c.Description,
-		addr: host,
+		r:       r,
+		name:    c.Name,
+		desc:    c.Description,
+		addr:    host,
+		metrics: newMetrics(),
 	}, nil
 }
 
@@ -95,6 +119,173 @@ var (
 type pluginRequest struct {
 	Name string          `json:"Name,omitempty"`
 	Opts core.VolumeOpts `json:"Opts,omitempty"`
+	ID   string          `json:"ID,omitempty"`
+}
+
+type ctxKey int
+
+// ctxKeyPeerCN is the context key holding the client certificate CN.
+const ctxKeyPeerCN ctxKey = iota
+
+// peerCN returns the CN attached to ctx by withPeerCN, or "".
+func peerCN(ctx context.Context) string {
+	cn, _ := ctx.Value(ctxKeyPeerCN).(string)
+	return cn
+}
+
+// withPeerCN attaches the client certificate's CN to the request context.
+func withPeerCN(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.TLS != nil && len(r.TLS.PeerCertificates) > 0 {
+			cn := r.TLS.PeerCertificates[0].Subject.CommonName
+			r = r.WithContext(context.WithValue(r.Context(), ctxKeyPeerCN, cn))
+		}
+		h.ServeHTTP(w, r)
+	})
+}
+
+// tlsConfigKey builds the rexray.modules.<name>.tls.<suffix> config key.
+func (m *mod) tlsConfigKey(suffix string) string {
+	return fmt.Sprintf("rexray.modules.%s.tls.%s", m.name, suffix)
+}
+
+// metricsLogInterval is how often logMetricsPeriodically logs.
+const metricsLogInterval = 5 * time.Minute
+
+// metrics tallies activity per route.
+type metrics struct {
+	mu     sync.Mutex
+	counts map[string]uint64
+}
+
+func newMetrics() *metrics {
+	return &metrics{counts: map[string]uint64{}}
+}
+
+func (mx *metrics) incr(route string) {
+	mx.mu.Lock()
+	defer mx.mu.Unlock()
+	mx.counts[route]++
+}
+
+// snapshot returns a copy of the current per-route counts.
+func (mx *metrics) snapshot() map[string]uint64 {
+	mx.mu.Lock()
+	defer mx.mu.Unlock()
+	out := make(map[string]uint64, len(mx.counts))
+	for route, n := range mx.counts {
+		out[route] = n
+	}
+	return out
+}
+
+// logMetricsPeriodically logs a snapshot of counts every metricsLogInterval.
+func (m *mod) logMetricsPeriodically() {
+	ticker := time.NewTicker(metricsLogInterval)
+	defer ticker.Stop()
+	for range ticker.C {
+		log.WithField("counts", m.metrics.snapshot()).
+			Debug("docker plugin request counts")
+	}
+}
+
+// handlerFunc is the signature every plugin route implements. store holds
+// the decoded pluginRequest under "pluginRequest".
+type handlerFunc func(ctx context.Context, w http.ResponseWriter, r *http.Request, store map[string]interface{}) error
+
+// middleware wraps a handlerFunc with cross-cutting behavior.
+type middleware func(route string, next handlerFunc) handlerFunc
+
+// loggingMiddleware logs the route and duration of every plugin request.
+func loggingMiddleware(route string, next handlerFunc) handlerFunc {
+	return func(ctx context.Context, w http.ResponseWriter, r *http.Request, store map[string]interface{}) error {
+		start := time.Now()
+		err := next(ctx, w, r, store)
+		log.WithField("route", route).
+			WithField("duration", time.Since(start)).
+			Debug("handled docker plugin request")
+		return err
+	}
+}
+
+// recoveryMiddleware converts a panic in next into an error so it is
+// reported to the caller as a {"Err":...} 500 instead of killing the Start
+// goroutine.
+func recoveryMiddleware(route string, next handlerFunc) handlerFunc {
+	return func(ctx context.Context, w http.ResponseWriter, r *http.Request, store map[string]interface{}) (err error) {
+		defer func() {
+			if p := recover(); p != nil {
+				log.WithField("route", route).WithField("panic", p).
+					Error("recovered from panic in docker plugin handler")
+				err = goof.WithField("panic", p, "internal error")
+			}
+		}()
+		return next(ctx, w, r, store)
+	}
+}
+
+// metricsMiddleware tallies every call to route, regardless of outcome.
+func metricsMiddleware(mx *metrics, route string, next handlerFunc) handlerFunc {
+	return func(ctx context.Context, w http.ResponseWriter, r *http.Request, store map[string]interface{}) error {
+		mx.incr(route)
+		return next(ctx, w, r, store)
+	}
+}
+
+// isAuthorized reports whether cn may invoke the plugin API. An empty cn
+// (no client certificate) is always allowed.
+func (m *mod) isAuthorized(cn string) bool {
+	if cn == "" {
+		return true
+	}
+	allowed := m.r.Config.GetString(m.tlsConfigKey("authorizedCNs"))
+	if allowed == "" {
+		return true
+	}
+	for _, a := range strings.Split(allowed, ",") {
+		if strings.TrimSpace(a) == cn {
+			return true
+		}
+	}
+	return false
+}
+
+// authzMiddleware rejects requests whose peer CN is not authorized.
+func (m *mod) authzMiddleware(route string, next handlerFunc) handlerFunc {
+	return func(ctx context.Context, w http.ResponseWriter, r *http.Request, store map[string]interface{}) error {
+		if !m.isAuthorized(peerCN(ctx)) {
+			return core.ErrPermissionDenied
+		}
+		return next(ctx, w, r, store)
+	}
+}
+
+// handleWithMiddleware decodes the request body, wraps h in the standard
+// middleware chain, and translates a returned error into a writeErr response.
+func (m *mod) handleWithMiddleware(route string, h handlerFunc) http.HandlerFunc {
+	wrapped := h
+	for _, mw := range []middleware{m.authzMiddleware, func(route string, next handlerFunc) handlerFunc {
+		return metricsMiddleware(m.metrics, route, next)
+	}, recoveryMiddleware, loggingMiddleware} {
+		wrapped = mw(route, wrapped)
+	}
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		store := map[string]interface{}{}
+
+		var pr pluginRequest
+		if err := json.NewDecoder(r.Body).Decode(&pr); err != nil && err != io.EOF {
+			log.WithField("route", route).WithField("error", err).
+				Error("error decoding docker plugin request")
+			writeErr(w, err)
+			return
+		}
+		store["pluginRequest"] = pr
+
+		if err := wrapped(r.Context(), w, r, store); err != nil {
+			writeErr(w, err)
+		}
+	}
 }
 
 func (m *mod) Start() error {
@@ -135,7 +326,7 @@ func (m *mod) Start() error {
 	var specPath string
 	var startFunc func() error
 
-	mux := m.buildMux()
+	handler := withPeerCN(m.buildMux())
 
 	if proto == "unix" {
 		sockFile := addr
@@ -156,19 +347,51 @@ func (m *mod) Start() error {
 			defer l.Close()
 			defer os.Remove(sockFile)
 
-			return http.Serve(l, mux)
+			return http.Serve(l, handler)
 		}
 	} else {
 		specPath = addr
-		startFunc = func() error {
-			s := &http.Server{
-				Addr:           addr,
-				Handler:        mux,
-				ReadTimeout:    10 * time.Second,
-				WriteTimeout:   10 * time.Second,
-				MaxHeaderBytes: 1 << 20,
+
+		s := &http.Server{
+			Addr:           addr,
+			Handler:        handler,
+			ReadTimeout:    10 * time.Second,
+			WriteTimeout:   10 * time.Second,
+			MaxHeaderBytes: 1 << 20,
+		}
+
+		certFile := m.r.Config.GetString(m.tlsConfigKey("certFile"))
+		keyFile := m.r.Config.GetString(m.tlsConfigKey("keyFile"))
+
+		if certFile == "" && keyFile == "" {
+			startFunc = func() error {
+				return s.ListenAndServe()
+			}
+		} else {
+			tlsConfig := &tls.Config{}
+
+			if m.r.Config.GetBool(m.tlsConfigKey("clientAuth")) {
+				caFile := m.r.Config.GetString(m.tlsConfigKey("caFile"))
+				caCert, readCAErr := ioutil.ReadFile(caFile)
+				if readCAErr != nil {
+					return goof.WithFieldsE(goof.Fields{
+						"caFile": caFile,
+					}, "error reading tls ca file", readCAErr)
+				}
+
+				caPool := x509.NewCertPool()
+				if !caPool.AppendCertsFromPEM(caCert) {
+					return goof.WithField("caFile", caFile, "error parsing tls ca file")
+				}
+
+				tlsConfig.ClientCAs = caPool
+				tlsConfig.ClientAuth = tls.RequireAndVerifyClientCert
+			}
+
+			s.TLSConfig = tlsConfig
+			startFunc = func() error {
+				return s.ListenAndServeTLS(certFile, keyFile)
 			}
-			return s.ListenAndServe()
 		}
 	}
 
@@ -179,6 +402,8 @@ func (m *mod) Start() error {
 		}
 	}()
 
+	go m.logMetricsPeriodically()
+
 	spec := m.r.Config.GetString("spec")
 	if spec == "" {
 		if m.name == "default-docker" {
@@ -216,154 +441,328 @@ func (m *mod) Address() string {
 	return m.addr
 }
 
-func (m *mod) buildMux() *http.ServeMux {
-
-	mux := http.NewServeMux()
+// rememberVolume records name in the in-process volume registry.
+func (m *mod) rememberVolume(name string) {
+	m.seenVolsRWL.Lock()
+	defer m.seenVolsRWL.Unlock()
+	if m.seenVols == nil {
+		m.seenVols = map[string]struct{}{}
+	}
+	m.seenVols[name] = struct{}{}
+}
 
-	mux.HandleFunc("/Plugin.Activate", func(w http.ResponseWriter, r *http.Request) {
-		w.Header().Set("Content-Type", "application/vnd.docker.plugins.v1.2+json")
-		fmt.Fprintln(w, `{"Implements": ["VolumeDriver"]}`)
-	})
+// forgetVolume removes name from the in-process volume registry.
+func (m *mod) forgetVolume(name string) {
+	m.seenVolsRWL.Lock()
+	defer m.seenVolsRWL.Unlock()
+	delete(m.seenVols, name)
+}
 
-	mux.HandleFunc("/VolumeDriver.Create", func(w http.ResponseWriter, r *http.Request) {
-		var pr pluginRequest
-		if err := json.NewDecoder(r.Body).Decode(&pr); err != nil {
-			http.Error(w, fmt.Sprintf("{\"Error\":\"%s\"}", err.Error()), 500)
-			log.WithField("error", err).Error("/VolumeDriver.Create: error decoding json")
-			return
-		}
+// listFromRegistry synthesizes a volume listing from the in-process
+// registry, dropping (never recreating) names that no longer resolve.
+func (m *mod) listFromRegistry() []core.VolumeMap {
+	m.seenVolsRWL.Lock()
+	names := make([]string, 0, len(m.seenVols))
+	for name := range m.seenVols {
+		names = append(names, name)
+	}
+	m.seenVolsRWL.Unlock()
 
-		err := m.r.Volume.Create(pr.Name, pr.Opts)
+	volList := make([]core.VolumeMap, 0, len(names))
+	for _, name := range names {
+		vol, err := m.r.Volume.Get(name)
 		if err != nil {
-			http.Error(w, fmt.Sprintf("{\"Error\":\"%s\"}", err.Error()), 500)
-			log.WithField("error", err.Error()).Error("/VolumeDriver.Create: error creating volume")
-			log.Error(err)
-			return
+			log.WithField("name", name).WithField("error", err).
+				Warn("/VolumeDriver.List: dropping unknown volume from registry")
+			m.forgetVolume(name)
+			continue
 		}
+		volList = append(volList, vol)
+	}
+	return volList
+}
 
-		w.Header().Set("Content-Type", "application/vnd.docker.plugins.v1.2+json")
-		fmt.Fprintln(w, `{}`)
-	})
+// addMountID records that id now holds name and reports whether it's the
+// first holder, i.e. whether name needs to be attached.
+func (m *mod) addMountID(name, id string) bool {
+	m.mountIDsRWL.Lock()
+	defer m.mountIDsRWL.Unlock()
+	if m.mountIDs == nil {
+		m.mountIDs = map[string]map[string]struct{}{}
+	}
+	ids, ok := m.mountIDs[name]
+	if !ok {
+		ids = map[string]struct{}{}
+		m.mountIDs[name] = ids
+	}
+	_, alreadyHeld := ids[id]
+	ids[id] = struct{}{}
+	return !alreadyHeld && len(ids) == 1
+}
 
-	mux.HandleFunc("/VolumeDriver.Remove", func(w http.ResponseWriter, r *http.Request) {
-		var pr pluginRequest
-		if err := json.NewDecoder(r.Body).Decode(&pr); err != nil {
-			http.Error(w, fmt.Sprintf("{\"Error\":\"%s\"}", err.Error()), 500)
-			log.WithField("error", err).Error("/VolumeDriver.Remove: error decoding json")
-			return
-		}
+// removeMountID releases id's hold on name and reports whether it was the
+// last holder, i.e. whether name needs to be unmounted.
+func (m *mod) removeMountID(name, id string) bool {
+	m.mountIDsRWL.Lock()
+	defer m.mountIDsRWL.Unlock()
+	ids, ok := m.mountIDs[name]
+	if !ok {
+		return true
+	}
+	delete(ids, id)
+	if len(ids) == 0 {
+		delete(m.mountIDs, name)
+		return true
+	}
+	return false
+}
 
-		err := m.r.Volume.Remove(pr.Name)
-		if err != nil {
-			http.Error(w, fmt.Sprintf("{\"Error\":\"%s\"}", err.Error()), 500)
-			log.WithField("error", err.Error()).Error("/VolumeDriver.Remove: error removing volume")
-			log.Error(err)
-			return
-		}
+// lockVolume blocks until name's lock is free, then returns its release func.
+func (m *mod) lockVolume(name string) func() {
+	m.volLocksRWL.Lock()
+	if m.volLocks == nil {
+		m.volLocks = map[string]*sync.Mutex{}
+	}
+	l, ok := m.volLocks[name]
+	if !ok {
+		l = &sync.Mutex{}
+		m.volLocks[name] = l
+	}
+	m.volLocksRWL.Unlock()
 
-		w.Header().Set("Content-Type", "application/vnd.docker.plugins.v1.2+json")
-		fmt.Fprintln(w, `{}`)
-	})
+	l.Lock()
+	return l.Unlock
+}
 
-	mux.HandleFunc("/VolumeDriver.Path", func(w http.ResponseWriter, r *http.Request) {
-		var pr pluginRequest
-		if err := json.NewDecoder(r.Body).Decode(&pr); err != nil {
-			http.Error(w, fmt.Sprintf("{\"Error\":\"%s\"}", err.Error()), 500)
-			log.WithField("error", err).Error("/VolumeDriver.Path: error decoding json")
-			return
+// causeOf unwinds a chain of wrapped *goof.Error values to the inner error.
+func causeOf(err error) error {
+	for {
+		gerr, ok := err.(*goof.Error)
+		if !ok || gerr.Inner == nil {
+			return err
 		}
+		err = gerr.Inner
+	}
+}
 
-		mountPath, err := m.r.Volume.Path(pr.Name, "")
-		if err != nil {
-			http.Error(w, fmt.Sprintf("{\"Error\":\"%s\"}", err.Error()), 500)
-			log.WithField("error", err.Error()).Error("/VolumeDriver.Path: error returning path")
-			log.Error(err)
-			return
-		}
+// statusForErr maps a core error to its Docker volume plugin HTTP status,
+// defaulting to 500.
+func statusForErr(err error) int {
+	switch causeOf(err) {
+	case core.ErrNotFound:
+		return http.StatusNotFound
+	case core.ErrAlreadyExists:
+		return http.StatusConflict
+	case core.ErrPermissionDenied:
+		return http.StatusForbidden
+	case core.ErrUnsupported:
+		return http.StatusNotImplemented
+	default:
+		return http.StatusInternalServerError
+	}
+}
 
-		w.Header().Set("Content-Type", "application/vnd.docker.plugins.v1.2+json")
-		fmt.Fprintln(w, fmt.Sprintf("{\"Mountpoint\": \"%s\"}", mountPath))
-	})
+// requireName returns core.ErrNotFound if pr.Name is empty.
+func requireName(pr pluginRequest) error {
+	if pr.Name == "" {
+		return core.ErrNotFound
+	}
+	return nil
+}
 
-	mux.HandleFunc("/VolumeDriver.Mount", func(w http.ResponseWriter, r *http.Request) {
-		var pr pluginRequest
-		if err := json.NewDecoder(r.Body).Decode(&pr); err != nil {
-			http.Error(w, fmt.Sprintf("{\"Error\":\"%s\"}", err.Error()), 500)
-			log.WithField("error", err).Error("/VolumeDriver.Mount: error decoding json")
-			return
-		}
+// writeErr JSON-encodes err using the "Err" key Docker's plugin protocol
+// expects, with a status code derived from statusForErr.
+func writeErr(w http.ResponseWriter, err error) {
+	w.Header().Set("Content-Type", pluginContentType)
+	w.WriteHeader(statusForErr(err))
+	json.NewEncoder(w).Encode(map[string]string{"Err": err.Error()})
+}
 
-		mountPath, err := m.r.Volume.Mount(pr.Name, "", false, "", false)
-		if err != nil {
-			http.Error(w, fmt.Sprintf("{\"Error\":\"%s\"}", err.Error()), 500)
-			log.WithField("error", err.Error()).Error("/VolumeDriver.Mount: error mounting volume")
-			log.Error(err)
-			return
-		}
+func activateHandler(ctx context.Context, w http.ResponseWriter, r *http.Request, store map[string]interface{}) error {
+	w.Header().Set("Content-Type", pluginContentType)
+	fmt.Fprintln(w, `{"Implements": ["VolumeDriver"]}`)
+	return nil
+}
 
-		w.Header().Set("Content-Type", "application/vnd.docker.plugins.v1.2+json")
-		fmt.Fprintln(w, fmt.Sprintf("{\"Mountpoint\": \"%s\"}", mountPath))
-	})
+func (m *mod) capabilitiesHandler(ctx context.Context, w http.ResponseWriter, r *http.Request, store map[string]interface{}) error {
+	scope := m.r.Volume.Scope()
 
-	mux.HandleFunc("/VolumeDriver.Unmount", func(w http.ResponseWriter, r *http.Request) {
-		var pr pluginRequest
-		if err := json.NewDecoder(r.Body).Decode(&pr); err != nil {
-			http.Error(w, fmt.Sprintf("{\"Error\":\"%s\"}", err.Error()), 500)
-			log.WithField("error", err).Error("/VolumeDriver.Unmount: error decoding json")
-			return
+	w.Header().Set("Content-Type", pluginContentType)
+	fmt.Fprintln(w, fmt.Sprintf(`{"Capabilities": {"Scope": "%s"}}`, scope))
+	return nil
+}
+
+func (m *mod) createHandler(ctx context.Context, w http.ResponseWriter, r *http.Request, store map[string]interface{}) error {
+	pr := store["pluginRequest"].(pluginRequest)
+
+	if err := m.r.Volume.Create(pr.Name, pr.Opts); err != nil {
+		log.WithField("error", err.Error()).Error("/VolumeDriver.Create: error creating volume")
+		return err
+	}
+	m.rememberVolume(pr.Name)
+
+	w.Header().Set("Content-Type", pluginContentType)
+	fmt.Fprintln(w, `{}`)
+	return nil
+}
+
+func (m *mod) removeHandler(ctx context.Context, w http.ResponseWriter, r *http.Request, store map[string]interface{}) error {
+	pr := store["pluginRequest"].(pluginRequest)
+
+	if err := requireName(pr); err != nil {
+		return err
+	}
+
+	if err := m.r.Volume.Remove(pr.Name); err != nil {
+		log.WithField("error", err.Error()).Error("/VolumeDriver.Remove: error removing volume")
+		return err
+	}
+	m.forgetVolume(pr.Name)
+
+	w.Header().Set("Content-Type", pluginContentType)
+	fmt.Fprintln(w, `{}`)
+	return nil
+}
+
+func (m *mod) pathHandler(ctx context.Context, w http.ResponseWriter, r *http.Request, store map[string]interface{}) error {
+	pr := store["pluginRequest"].(pluginRequest)
+
+	if err := requireName(pr); err != nil {
+		return err
+	}
+
+	mountPath, err := m.r.Volume.Path(pr.Name, "")
+	if err != nil {
+		log.WithField("error", err.Error()).Error("/VolumeDriver.Path: error returning path")
+		return err
+	}
+	m.rememberVolume(pr.Name)
+
+	w.Header().Set("Content-Type", pluginContentType)
+	fmt.Fprintln(w, fmt.Sprintf("{\"Mountpoint\": \"%s\"}", mountPath))
+	return nil
+}
+
+func (m *mod) mountHandler(ctx context.Context, w http.ResponseWriter, r *http.Request, store map[string]interface{}) error {
+	pr := store["pluginRequest"].(pluginRequest)
+
+	if err := requireName(pr); err != nil {
+		return err
+	}
+
+	unlock := m.lockVolume(pr.Name)
+	defer unlock()
+
+	needsAttach := true
+	if pr.ID != "" {
+		needsAttach = m.addMountID(pr.Name, pr.ID)
+	}
+
+	var mountPath string
+	var err error
+	if needsAttach {
+		mountPath, err = m.r.Volume.Mount(pr.Name, "", false, "", false)
+		if err != nil && pr.ID != "" {
+			// Undo the bookkeeping from addMountID so a retry with the same
+			// ID attempts a real Mount again instead of being treated as an
+			// existing holder and handed a stale Path.
+			m.removeMountID(pr.Name, pr.ID)
 		}
+	} else {
+		mountPath, err = m.r.Volume.Path(pr.Name, "")
+	}
+	if err != nil {
+		log.WithField("error", err.Error()).Error("/VolumeDriver.Mount: error mounting volume")
+		return err
+	}
+	m.rememberVolume(pr.Name)
 
-		err := m.r.Volume.Unmount(pr.Name, "")
-		if err != nil {
-			http.Error(w, fmt.Sprintf("{\"Error\":\"%s\"}", err.Error()), 500)
+	w.Header().Set("Content-Type", pluginContentType)
+	fmt.Fprintln(w, fmt.Sprintf("{\"Mountpoint\": \"%s\"}", mountPath))
+	return nil
+}
+
+func (m *mod) unmountHandler(ctx context.Context, w http.ResponseWriter, r *http.Request, store map[string]interface{}) error {
+	pr := store["pluginRequest"].(pluginRequest)
+
+	if err := requireName(pr); err != nil {
+		return err
+	}
+
+	unlock := m.lockVolume(pr.Name)
+	defer unlock()
+
+	needsDetach := true
+	if pr.ID != "" {
+		needsDetach = m.removeMountID(pr.Name, pr.ID)
+	}
+
+	if needsDetach {
+		if err := m.r.Volume.Unmount(pr.Name, ""); err != nil {
 			log.WithField("error", err.Error()).Error("/VolumeDriver.Unmount: error unmounting volume")
-			log.Error(err)
-			return
+			return err
 		}
+	}
 
-		w.Header().Set("Content-Type", "application/vnd.docker.plugins.v1.2+json")
-		fmt.Fprintln(w, `{}`)
-	})
+	w.Header().Set("Content-Type", pluginContentType)
+	fmt.Fprintln(w, `{}`)
+	return nil
+}
 
-	mux.HandleFunc("/VolumeDriver.Get", func(w http.ResponseWriter, r *http.Request) {
-		var pr pluginRequest
-		if err := json.NewDecoder(r.Body).Decode(&pr); err != nil {
-			http.Error(w, fmt.Sprintf("{\"Error\":\"%s\"}", err.Error()), 500)
-			log.WithField("error", err).Error("/VolumeDriver.Path: error decoding json")
-			return
-		}
+func (m *mod) getHandler(ctx context.Context, w http.ResponseWriter, r *http.Request, store map[string]interface{}) error {
+	pr := store["pluginRequest"].(pluginRequest)
 
-		vol, err := m.r.Volume.Get(pr.Name)
-		if err != nil {
-			http.Error(w, fmt.Sprintf("{\"Error\":\"%s\"}", err.Error()), 500)
-			log.WithField("error", err.Error()).Error("/VolumeDriver.Get: error getting volume")
-			log.Error(err)
-			return
-		}
+	if err := requireName(pr); err != nil {
+		return err
+	}
 
-		w.Header().Set("Content-Type", "application/vnd.docker.plugins.v1.2+json")
-		json.NewEncoder(w).Encode(map[string]core.VolumeMap{"Volume": vol})
-	})
+	vol, err := m.r.Volume.Get(pr.Name)
+	if err != nil {
+		log.WithField("error", err.Error()).Error("/VolumeDriver.Get: error getting volume")
+		return err
+	}
 
-	mux.HandleFunc("/VolumeDriver.List", func(w http.ResponseWriter, r *http.Request) {
-		var pr pluginRequest
-		if err := json.NewDecoder(r.Body).Decode(&pr); err != nil {
-			http.Error(w, fmt.Sprintf("{\"Error\":\"%s\"}", err.Error()), 500)
-			log.WithField("error", err).Error("/VolumeDriver.List: error decoding json")
-			return
-		}
+	w.Header().Set("Content-Type", pluginContentType)
+	json.NewEncoder(w).Encode(map[string]core.VolumeMap{"Volume": vol})
+	return nil
+}
 
-		volList, err := m.r.Volume.List()
-		if err != nil {
-			http.Error(w, fmt.Sprintf("{\"Error\":\"%s\"}", err.Error()), 500)
-			log.WithField("error", err.Error()).Error("/VolumeDriver.List: error listing volumes")
-			log.Error(err)
-			return
-		}
+func (m *mod) listHandler(ctx context.Context, w http.ResponseWriter, r *http.Request, store map[string]interface{}) error {
+	volList, err := m.r.Volume.List()
+	if err == core.ErrListNotSupported {
+		volList = m.listFromRegistry()
+	} else if err != nil {
+		log.WithField("error", err.Error()).Error("/VolumeDriver.List: error listing volumes")
+		return err
+	}
 
-		w.Header().Set("Content-Type", "application/vnd.docker.plugins.v1.2+json")
-		json.NewEncoder(w).Encode(map[string][]core.VolumeMap{"Volumes": volList})
-	})
+	w.Header().Set("Content-Type", pluginContentType)
+	json.NewEncoder(w).Encode(map[string][]core.VolumeMap{"Volumes": volList})
+	return nil
+}
+
+func (m *mod) buildMux() *http.ServeMux {
+
+	mux := http.NewServeMux()
+
+	mux.HandleFunc("/Plugin.Activate",
+		m.handleWithMiddleware("/Plugin.Activate", activateHandler))
+	mux.HandleFunc("/VolumeDriver.Capabilities",
+		m.handleWithMiddleware("/VolumeDriver.Capabilities", m.capabilitiesHandler))
+	mux.HandleFunc("/VolumeDriver.Create",
+		m.handleWithMiddleware("/VolumeDriver.Create", m.createHandler))
+	mux.HandleFunc("/VolumeDriver.Remove",
+		m.handleWithMiddleware("/VolumeDriver.Remove", m.removeHandler))
+	mux.HandleFunc("/VolumeDriver.Path",
+		m.handleWithMiddleware("/VolumeDriver.Path", m.pathHandler))
+	mux.HandleFunc("/VolumeDriver.Mount",
+		m.handleWithMiddleware("/VolumeDriver.Mount", m.mountHandler))
+	mux.HandleFunc("/VolumeDriver.Unmount",
+		m.handleWithMiddleware("/VolumeDriver.Unmount", m.unmountHandler))
+	mux.HandleFunc("/VolumeDriver.Get",
+		m.handleWithMiddleware("/VolumeDriver.Get", m.getHandler))
+	mux.HandleFunc("/VolumeDriver.List",
+		m.handleWithMiddleware("/VolumeDriver.List", m.listHandler))
 
 	return mux
 }
@@ -0,0 +1,82 @@
+package volumedriver
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/akutz/goof"
+
+	"github.com/emccode/rexray/core"
+)
+
+func TestAddMountIDFirstHolderNeedsAttach(t *testing.T) {
+	m := &mod{}
+	if needsAttach := m.addMountID("vol1", "container1"); !needsAttach {
+		t.Fatal("first holder should need attach")
+	}
+}
+
+func TestAddMountIDSecondHolderSkipsAttach(t *testing.T) {
+	m := &mod{}
+	m.addMountID("vol1", "container1")
+	if needsAttach := m.addMountID("vol1", "container2"); needsAttach {
+		t.Fatal("second holder should not need attach")
+	}
+}
+
+func TestAddMountIDSameHolderIsIdempotent(t *testing.T) {
+	m := &mod{}
+	m.addMountID("vol1", "container1")
+	if needsAttach := m.addMountID("vol1", "container1"); needsAttach {
+		t.Fatal("re-adding the same holder should not report needsAttach")
+	}
+}
+
+func TestRemoveMountIDLastHolderNeedsDetach(t *testing.T) {
+	m := &mod{}
+	m.addMountID("vol1", "container1")
+	if needsDetach := m.removeMountID("vol1", "container1"); !needsDetach {
+		t.Fatal("last holder should need detach")
+	}
+}
+
+func TestRemoveMountIDRemainingHolderSkipsDetach(t *testing.T) {
+	m := &mod{}
+	m.addMountID("vol1", "container1")
+	m.addMountID("vol1", "container2")
+	if needsDetach := m.removeMountID("vol1", "container1"); needsDetach {
+		t.Fatal("remaining holder should not need detach")
+	}
+}
+
+func TestRemoveMountIDUnknownNameNeedsDetach(t *testing.T) {
+	m := &mod{}
+	if needsDetach := m.removeMountID("unknown", "container1"); !needsDetach {
+		t.Fatal("unknown volume should report needsDetach so callers don't silently skip")
+	}
+}
+
+func TestStatusForErrMapsCoreSentinels(t *testing.T) {
+	cases := []struct {
+		err    error
+		status int
+	}{
+		{core.ErrNotFound, http.StatusNotFound},
+		{core.ErrAlreadyExists, http.StatusConflict},
+		{core.ErrPermissionDenied, http.StatusForbidden},
+		{core.ErrUnsupported, http.StatusNotImplemented},
+		{goof.New("boom"), http.StatusInternalServerError},
+	}
+	for _, c := range cases {
+		if got := statusForErr(c.err); got != c.status {
+			t.Errorf("statusForErr(%v) = %d, want %d", c.err, got, c.status)
+		}
+	}
+}
+
+func TestStatusForErrUnwrapsWrappedSentinel(t *testing.T) {
+	wrapped := goof.WithFieldsE(goof.Fields{"name": "vol1"}, "driver error", core.ErrNotFound)
+	if got := statusForErr(wrapped); got != http.StatusNotFound {
+		t.Errorf("statusForErr(wrapped) = %d, want %d", got, http.StatusNotFound)
+	}
+}